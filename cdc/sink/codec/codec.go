@@ -0,0 +1,51 @@
+package codec
+
+import "github.com/pingcap/errors"
+
+// Protocol is the protocol used to encode and dispatch row changed events
+// and DDL events to a message queue sink.
+type Protocol int
+
+// Enum types of the available protocols.
+const (
+	ProtocolDefault Protocol = iota
+	ProtocolCanal
+	ProtocolCanalJSON
+	ProtocolAvro
+	ProtocolMaxwell
+)
+
+// String implements fmt.Stringer interface.
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolCanal:
+		return "canal"
+	case ProtocolCanalJSON:
+		return "canal-json"
+	case ProtocolAvro:
+		return "avro"
+	case ProtocolMaxwell:
+		return "maxwell"
+	default:
+		return "default"
+	}
+}
+
+// ParseProtocol parses the protocol name into a Protocol, returning an
+// error if the name is not one of the supported protocols.
+func ParseProtocol(name string) (Protocol, error) {
+	switch name {
+	case "", "default":
+		return ProtocolDefault, nil
+	case "canal":
+		return ProtocolCanal, nil
+	case "canal-json":
+		return ProtocolCanalJSON, nil
+	case "avro":
+		return ProtocolAvro, nil
+	case "maxwell":
+		return ProtocolMaxwell, nil
+	default:
+		return ProtocolDefault, errors.Errorf("unknown protocol: %s", name)
+	}
+}
@@ -0,0 +1,54 @@
+package codec
+
+import "testing"
+
+func TestParseProtocol(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected Protocol
+		wantErr  bool
+	}{
+		{"", ProtocolDefault, false},
+		{"default", ProtocolDefault, false},
+		{"canal", ProtocolCanal, false},
+		{"canal-json", ProtocolCanalJSON, false},
+		{"avro", ProtocolAvro, false},
+		{"maxwell", ProtocolMaxwell, false},
+		{"bogus", ProtocolDefault, true},
+	}
+
+	for _, c := range cases {
+		p, err := ParseProtocol(c.name)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseProtocol(%q): expected an error, got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseProtocol(%q): unexpected error: %v", c.name, err)
+		}
+		if p != c.expected {
+			t.Errorf("ParseProtocol(%q) = %v, want %v", c.name, p, c.expected)
+		}
+	}
+}
+
+func TestProtocolString(t *testing.T) {
+	cases := []struct {
+		protocol Protocol
+		expected string
+	}{
+		{ProtocolDefault, "default"},
+		{ProtocolCanal, "canal"},
+		{ProtocolCanalJSON, "canal-json"},
+		{ProtocolAvro, "avro"},
+		{ProtocolMaxwell, "maxwell"},
+	}
+
+	for _, c := range cases {
+		if got := c.protocol.String(); got != c.expected {
+			t.Errorf("Protocol(%d).String() = %q, want %q", c.protocol, got, c.expected)
+		}
+	}
+}
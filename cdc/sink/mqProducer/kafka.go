@@ -2,12 +2,17 @@ package mqProducer
 
 import (
 	"context"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/cdc/util"
 	"go.uber.org/zap"
 )
 
@@ -15,37 +20,333 @@ import (
 type KafkaConfig struct {
 	Version         string
 	MaxMessageBytes int
+
+	// NumPartitions and ReplicationFactor are only used when the topic does
+	// not already exist and has to be created automatically.
+	NumPartitions     int32
+	ReplicationFactor int16
+	// TopicPreProcess is a set of topic-level configs (e.g. "max.message.bytes",
+	// "retention.ms") applied when the topic is created automatically.
+	TopicPreProcess map[string]*string
+
+	// TopicRefreshInterval controls how often the topic manager refetches
+	// the topic's partition metadata, so that partitions added externally
+	// are picked up without restarting the changefeed.
+	TopicRefreshInterval time.Duration
+
+	// Protocol selects how row changed events and DDL events are encoded
+	// and dispatched to partitions.
+	Protocol codec.Protocol
+
+	// Credential configures TLS and SASL/Kerberos authentication against
+	// the Kafka brokers.
+	Credential util.SecurityOption
+
+	// Mode selects the underlying Sarama producer: "sync" sends one message
+	// at a time and waits for its ack, "async" batches messages through a
+	// bounded in-memory queue for higher throughput.
+	Mode string
+	// MaxInflight bounds the in-memory queue used by the async producer;
+	// SendMessage blocks once it is full, providing back pressure.
+	MaxInflight int
+	// LingerMs is how long the async producer waits to batch up messages
+	// before flushing, mirroring Kafka's own producer linger.ms.
+	LingerMs int
+	// CompressionCodec is one of "none", "gzip", "snappy", "lz4", or "zstd".
+	CompressionCodec string
 }
 
+const (
+	// KafkaProducerModeSync sends one message at a time and waits for it to
+	// be acknowledged before returning.
+	KafkaProducerModeSync = "sync"
+	// KafkaProducerModeAsync batches messages through sarama.AsyncProducer;
+	// callers must use Flush to wait for outstanding messages to be acked.
+	KafkaProducerModeAsync = "async"
+)
+
 // DefaultKafkaConfig is the default Kafka configuration
 var DefaultKafkaConfig = KafkaConfig{
-	Version:         "2.4.0",
-	MaxMessageBytes: 1 << 26, // 64M
+	Version:              "2.4.0",
+	MaxMessageBytes:      1 << 26, // 64M
+	NumPartitions:        3,
+	ReplicationFactor:    1,
+	TopicRefreshInterval: 10 * time.Minute,
+	Mode:                 KafkaProducerModeSync,
+	MaxInflight:          256,
+	LingerMs:             100,
+	CompressionCodec:     "none",
+}
+
+// KafkaTopicManager is used to create a topic and fetch topic information
+// from Kafka. It periodically refreshes the partition count of the managed
+// topic so newly added partitions are picked up without requiring a restart.
+type KafkaTopicManager struct {
+	admin sarama.ClusterAdmin
+	topic string
+	cfg   KafkaConfig
+
+	partitionNum int32
+
+	closeCh chan struct{}
+	closeWg sync.WaitGroup
+}
+
+// NewKafkaTopicManager creates a new KafkaTopicManager, creating the topic
+// if it does not exist yet and starting a background goroutine that keeps
+// the partition count up to date.
+func NewKafkaTopicManager(admin sarama.ClusterAdmin, topic string, cfg KafkaConfig) (*KafkaTopicManager, error) {
+	m := &KafkaTopicManager{
+		admin:   admin,
+		topic:   topic,
+		cfg:     cfg,
+		closeCh: make(chan struct{}),
+	}
+	if err := m.createOrValidateTopic(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	interval := cfg.TopicRefreshInterval
+	if interval <= 0 {
+		interval = DefaultKafkaConfig.TopicRefreshInterval
+	}
+	m.closeWg.Add(1)
+	go m.backgroundRefresh(interval)
+
+	return m, nil
+}
+
+// createOrValidateTopic creates the topic when it is missing, or, if it
+// already exists, fetches its partition count and validates that the
+// broker's max.message.bytes is large enough for this producer's config.
+func (m *KafkaTopicManager) createOrValidateTopic() error {
+	topics, err := m.admin.ListTopics()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	detail, ok := topics[m.topic]
+	if !ok {
+		numPartitions := m.cfg.NumPartitions
+		if numPartitions <= 0 {
+			numPartitions = DefaultKafkaConfig.NumPartitions
+		}
+		replicationFactor := m.cfg.ReplicationFactor
+		if replicationFactor <= 0 {
+			replicationFactor = DefaultKafkaConfig.ReplicationFactor
+		}
+		err = m.admin.CreateTopic(m.topic, &sarama.TopicDetail{
+			NumPartitions:     numPartitions,
+			ReplicationFactor: replicationFactor,
+			ConfigEntries:     m.cfg.TopicPreProcess,
+		}, false)
+		if err != nil {
+			if err != sarama.ErrTopicAlreadyExists {
+				return errors.Trace(err)
+			}
+			// Someone else created the topic concurrently; don't trust our
+			// own requested partition count, read back what actually exists.
+			log.Info("kafka topic already exists, refreshing partition count", zap.String("topic", m.topic))
+			return m.refreshPartitionNum()
+		}
+		atomic.StoreInt32(&m.partitionNum, numPartitions)
+		log.Info("created kafka topic", zap.String("topic", m.topic), zap.Int32("partitionNum", numPartitions))
+		return nil
+	}
+
+	if err := m.validateMaxMessageBytes(detail); err != nil {
+		return errors.Trace(err)
+	}
+	return m.refreshPartitionNum()
+}
+
+// validateMaxMessageBytes checks that the broker's max.message.bytes for the
+// topic is not smaller than the producer's configured MaxMessageBytes.
+func (m *KafkaTopicManager) validateMaxMessageBytes(detail sarama.TopicDetail) error {
+	brokerCfg, ok := detail.ConfigEntries["max.message.bytes"]
+	if !ok || brokerCfg == nil {
+		return nil
+	}
+	maxMessageBytes, err := strconv.Atoi(*brokerCfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if maxMessageBytes < m.cfg.MaxMessageBytes {
+		return errors.Errorf(
+			"topic %s's max.message.bytes %d is smaller than the producer's MaxMessageBytes %d",
+			m.topic, maxMessageBytes, m.cfg.MaxMessageBytes)
+	}
+	return nil
+}
+
+// refreshPartitionNum re-reads the topic's metadata from the broker and
+// updates the cached partition count.
+func (m *KafkaTopicManager) refreshPartitionNum() error {
+	meta, err := m.admin.DescribeTopics([]string{m.topic})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(meta) == 0 || meta[0] == nil {
+		return errors.Errorf("topic %s not found", m.topic)
+	}
+	atomic.StoreInt32(&m.partitionNum, int32(len(meta[0].Partitions)))
+	return nil
+}
+
+func (m *KafkaTopicManager) backgroundRefresh(interval time.Duration) {
+	defer m.closeWg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.closeCh:
+			return
+		case <-ticker.C:
+			if err := m.refreshPartitionNum(); err != nil {
+				log.Warn("refresh kafka topic partition number failed", zap.String("topic", m.topic), zap.Error(err))
+			}
+		}
+	}
+}
+
+// GetPartitionNum returns the last known partition number for the topic.
+func (m *KafkaTopicManager) GetPartitionNum() int32 {
+	return atomic.LoadInt32(&m.partitionNum)
+}
+
+// Close stops the background refresh goroutine and releases the admin
+// client's broker connections.
+func (m *KafkaTopicManager) Close() error {
+	close(m.closeCh)
+	m.closeWg.Wait()
+	return errors.Trace(m.admin.Close())
 }
 
 type kafkaSaramaProducer struct {
-	client       sarama.SyncProducer
+	// client is used when config.Mode is KafkaProducerModeSync.
+	client sarama.SyncProducer
+	// asyncClient and the fields below are used when config.Mode is
+	// KafkaProducerModeAsync. SendMessage enforces maxInflight itself via
+	// inflightSem, since sarama's AsyncProducer continuously drains its own
+	// Input() channel and so won't apply back pressure on its own.
+	asyncClient sarama.AsyncProducer
+	maxInflight int
+	// inflightSem bounds the number of outstanding async messages: SendMessage
+	// acquires a slot by sending into it and ackOne releases one by receiving
+	// from it. Acquiring via channel select lets SendMessage honor ctx
+	// cancellation without spawning a watcher goroutine on every call.
+	inflightSem chan struct{}
+	// seqMu guards reservedSeq/ackedSeq, the monotonic counters Flush uses to
+	// wait only for messages reserved before it was called; sends that race
+	// with a Flush call must not extend that Flush's wait.
+	seqMu       sync.Mutex
+	seqCond     *sync.Cond
+	reservedSeq int64
+	ackedSeq    int64
+
+	topicManager *KafkaTopicManager
 	topic        string
-	partitionNum int32
+	protocol     codec.Protocol
+
+	asyncErrMu sync.Mutex
+	asyncErr   error
+
+	closeWg sync.WaitGroup
 }
 
-// NewKafkaSaramaProducer creates a kafka sarama producer
-func NewKafkaSaramaProducer(address string, topic string, partitionNum int32, config KafkaConfig) (*kafkaSaramaProducer, error) {
+// NewKafkaSaramaProducer creates a kafka sarama producer. It uses a
+// sarama.ClusterAdmin under the hood to automatically create the topic if
+// it doesn't exist, or discover its partition count if it does, so callers
+// no longer need to pre-provision the topic or hard-code the partition
+// number. Depending on config.Mode, it uses either a synchronous producer
+// that waits for every message's ack, or an async producer with a bounded
+// in-memory queue; see Flush for waiting on outstanding async messages.
+func NewKafkaSaramaProducer(address string, topic string, config KafkaConfig) (*kafkaSaramaProducer, error) {
 	cfg, err := newSaramaConfig(config)
 	if err != nil {
 		return nil, err
 	}
-	// TODO create topic automatically, get partition number automatically
-	client, err := sarama.NewSyncProducer(strings.Split(address, ","), cfg)
+	addrs := strings.Split(address, ",")
+
+	admin, err := sarama.NewClusterAdmin(addrs, cfg)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	topicManager, err := NewKafkaTopicManager(admin, topic, config)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to create the topic manager for topic %s", topic)
+	}
 
-	return &kafkaSaramaProducer{
-		client:       client,
+	k := &kafkaSaramaProducer{
+		topicManager: topicManager,
 		topic:        topic,
-		partitionNum: partitionNum,
-	}, nil
+		protocol:     config.Protocol,
+	}
+
+	if config.Mode == KafkaProducerModeAsync {
+		asyncClient, err := sarama.NewAsyncProducer(addrs, cfg)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		k.asyncClient = asyncClient
+		k.maxInflight = config.MaxInflight
+		if k.maxInflight <= 0 {
+			k.maxInflight = DefaultKafkaConfig.MaxInflight
+		}
+		k.inflightSem = make(chan struct{}, k.maxInflight)
+		k.seqCond = sync.NewCond(&k.seqMu)
+		k.closeWg.Add(1)
+		go k.handleAsyncAcks()
+	} else {
+		client, err := sarama.NewSyncProducer(addrs, cfg)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		k.client = client
+	}
+
+	return k, nil
+}
+
+// handleAsyncAcks drains the async producer's Successes and Errors
+// channels, releasing an inflightSem slot and advancing ackedSeq for each
+// ack so Flush can unblock once every message up to a resolved-ts
+// checkpoint has been acknowledged.
+func (k *kafkaSaramaProducer) handleAsyncAcks() {
+	defer k.closeWg.Done()
+	for {
+		select {
+		case _, ok := <-k.asyncClient.Successes():
+			if !ok {
+				return
+			}
+			k.ackOne(nil)
+		case err, ok := <-k.asyncClient.Errors():
+			if !ok {
+				return
+			}
+			k.ackOne(errors.Trace(err.Err))
+		}
+	}
+}
+
+func (k *kafkaSaramaProducer) ackOne(err error) {
+	<-k.inflightSem
+
+	// Record the error before advancing ackedSeq, so a Flush woken by this
+	// ack returns it.
+	if err != nil {
+		k.asyncErrMu.Lock()
+		if k.asyncErr == nil {
+			k.asyncErr = err
+		}
+		k.asyncErrMu.Unlock()
+	}
+
+	k.seqMu.Lock()
+	k.ackedSeq++
+	k.seqCond.Broadcast()
+	k.seqMu.Unlock()
 }
 
 // NewSaramaConfig return the default config and set the according version and metrics
@@ -65,28 +366,220 @@ func newSaramaConfig(c KafkaConfig) (*sarama.Config, error) {
 	config.Metadata.Retry.Max = 10000
 	config.Metadata.Retry.Backoff = 500 * time.Millisecond
 
-	config.Producer.Partitioner = sarama.NewManualPartitioner
+	// Avro relies on schema-registry-registered keys to route records, so
+	// it must hash on the key rather than dispatch by an explicit partition.
+	if c.Protocol == codec.ProtocolAvro {
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	} else {
+		config.Producer.Partitioner = sarama.NewManualPartitioner
+	}
 	config.Producer.MaxMessageBytes = 1 << 30
 	config.Producer.Return.Successes = true
 	config.Producer.RequiredAcks = sarama.WaitForAll
 
 	config.Producer.Retry.Max = 10000
 	config.Producer.Retry.Backoff = 500 * time.Millisecond
+
+	if c.Mode == KafkaProducerModeAsync {
+		config.Producer.Return.Errors = true
+		maxInflight := c.MaxInflight
+		if maxInflight <= 0 {
+			maxInflight = DefaultKafkaConfig.MaxInflight
+		}
+		config.ChannelBufferSize = maxInflight
+		lingerMs := c.LingerMs
+		if lingerMs <= 0 {
+			lingerMs = DefaultKafkaConfig.LingerMs
+		}
+		config.Producer.Flush.Frequency = time.Duration(lingerMs) * time.Millisecond
+
+		// Retries are enabled above, but a broker connection allows up to
+		// 5 concurrent in-flight requests by default, so a retried message
+		// could be sent and land after a later one on the same partition.
+		// Idempotent production requires exactly one in-flight request per
+		// connection; without it, per-partition ordering would not hold.
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+
+	compression, err := parseCompressionCodec(c.CompressionCodec)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	config.Producer.Compression = compression
+
+	if err := ConfigureSecurity(config, c.Credential); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	return config, err
 }
 
+// parseCompressionCodec maps a user-facing compression name to the
+// corresponding sarama.CompressionCodec.
+func parseCompressionCodec(name string) (sarama.CompressionCodec, error) {
+	switch name {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return sarama.CompressionNone, errors.Errorf("unknown compression codec: %s", name)
+	}
+}
+
+// ConfigureSecurity sets up TLS and SASL/Kerberos authentication on the
+// Sarama config from the given credential.
+func ConfigureSecurity(config *sarama.Config, credential util.SecurityOption) error {
+	tlsCfg, err := credential.ToTLSConfig()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if tlsCfg != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsCfg
+	}
+
+	if credential.SASLMechanism == "" {
+		return nil
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Mechanism = sarama.SASLMechanism(credential.SASLMechanism)
+	switch config.Net.SASL.Mechanism {
+	case sarama.SASLTypePlaintext:
+		config.Net.SASL.User = credential.SASLUser
+		config.Net.SASL.Password = credential.SASLPassword
+	case sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.User = credential.SASLUser
+		config.Net.SASL.Password = credential.SASLPassword
+		config.Net.SASL.Handshake = true
+		config.Net.SASL.SCRAMClientGeneratorFunc = scramClientGeneratorFunc(config.Net.SASL.Mechanism)
+	case sarama.SASLTypeGSSAPI:
+		config.Net.SASL.GSSAPI.ServiceName = credential.KerberosServiceName
+		config.Net.SASL.GSSAPI.Realm = credential.KerberosRealm
+		config.Net.SASL.GSSAPI.Username = credential.KerberosUsername
+		config.Net.SASL.GSSAPI.KerberosConfigPath = credential.KerberosConfigPath
+		if credential.KerberosKeytabPath != "" {
+			config.Net.SASL.GSSAPI.AuthType = sarama.KRB5_KEYTAB_AUTH
+			config.Net.SASL.GSSAPI.KeyTabPath = credential.KerberosKeytabPath
+		} else {
+			config.Net.SASL.GSSAPI.AuthType = sarama.KRB5_USER_AUTH
+			config.Net.SASL.GSSAPI.Password = credential.KerberosPassword
+		}
+	default:
+		return errors.Errorf("unknown SASL mechanism: %s", credential.SASLMechanism)
+	}
+	return nil
+}
+
 func (k *kafkaSaramaProducer) SendMessage(ctx context.Context, key []byte, value []byte, partition int32) error {
-	_, _, err := k.client.SendMessage(&sarama.ProducerMessage{
+	msg := &sarama.ProducerMessage{
 		Topic:     k.topic,
 		Key:       sarama.ByteEncoder(key),
 		Value:     sarama.ByteEncoder(value),
 		Partition: partition,
-	})
+	}
+
+	if k.asyncClient == nil {
+		_, _, err := k.client.SendMessage(msg)
+		return errors.Trace(err)
+	}
+
+	if err := k.reserveInflightSlot(ctx); err != nil {
+		return err
+	}
+
+	select {
+	case k.asyncClient.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		k.ackOne(nil)
+		return errors.Trace(ctx.Err())
+	}
+}
+
+// reserveInflightSlot blocks until fewer than maxInflight async messages are
+// outstanding, then reserves a slot by acquiring it from inflightSem. This is
+// the actual back pressure mechanism for the async producer: sarama's
+// AsyncProducer continuously drains its own Input() channel regardless of
+// how slowly the brokers ack, so without this the in-memory queue would be
+// unbounded. Acquiring via select on the channel lets a blocked call return
+// as soon as ctx is done, with no dedicated goroutine per call.
+func (k *kafkaSaramaProducer) reserveInflightSlot(ctx context.Context) error {
+	select {
+	case k.inflightSem <- struct{}{}:
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+
+	k.seqMu.Lock()
+	k.reservedSeq++
+	k.seqMu.Unlock()
+	return nil
+}
+
+// Flush blocks until every message accepted by SendMessage or
+// BroadcastMessage before this call was made has been acknowledged by the
+// brokers, so callers can safely advance the changefeed's resolvedTs
+// checkpoint in etcd only after the data it covers is durably persisted. It
+// is a no-op for the sync producer, which already waits on every call.
+//
+// Flush only waits on reservedSeq as it stood when called, not on messages
+// sent concurrently by other goroutines afterwards, so a running changefeed
+// that keeps calling SendMessage under load cannot stall Flush indefinitely.
+func (k *kafkaSaramaProducer) Flush(ctx context.Context) error {
+	if k.asyncClient == nil {
+		return nil
+	}
+
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go func() {
+		select {
+		case <-ctx.Done():
+			k.seqMu.Lock()
+			k.seqCond.Broadcast()
+			k.seqMu.Unlock()
+		case <-stopWatch:
+		}
+	}()
+
+	k.seqMu.Lock()
+	target := k.reservedSeq
+	for k.ackedSeq < target {
+		if ctx.Err() != nil {
+			k.seqMu.Unlock()
+			return errors.Trace(ctx.Err())
+		}
+		k.seqCond.Wait()
+	}
+	k.seqMu.Unlock()
+
+	k.asyncErrMu.Lock()
+	err := k.asyncErr
+	k.asyncErr = nil
+	k.asyncErrMu.Unlock()
 	return errors.Trace(err)
 }
 
+// BroadcastMessage sends a message to every partition of the topic, used
+// for DDL and resolved-ts events that every consumer must observe. Under the
+// canal-json protocol every broadcast message, DDL and resolved-ts alike, is
+// sent to partition 0 only, matching how the canal-json decoder expects to
+// see DDL on a single, well-known partition.
 func (k *kafkaSaramaProducer) BroadcastMessage(ctx context.Context, key []byte, value []byte) error {
-	for i := int32(0); i < k.partitionNum; i++ {
+	if k.protocol == codec.ProtocolCanalJSON {
+		return k.SendMessage(ctx, key, value, 0)
+	}
+	partitionNum := k.GetPartitionNum()
+	for i := int32(0); i < partitionNum; i++ {
 		err := k.SendMessage(ctx, key, value, i)
 		if err != nil {
 			return errors.Trace(err)
@@ -96,5 +589,20 @@ func (k *kafkaSaramaProducer) BroadcastMessage(ctx context.Context, key []byte,
 }
 
 func (k *kafkaSaramaProducer) GetPartitionNum() int32 {
-	return k.partitionNum
+	return k.topicManager.GetPartitionNum()
+}
+
+// Close closes the producer and stops the topic manager's background
+// refresh goroutine.
+func (k *kafkaSaramaProducer) Close() error {
+	if err := k.topicManager.Close(); err != nil {
+		log.Warn("close kafka topic manager failed", zap.Error(err))
+	}
+
+	if k.asyncClient != nil {
+		k.asyncClient.AsyncClose()
+		k.closeWg.Wait()
+		return nil
+	}
+	return errors.Trace(k.client.Close())
 }
@@ -0,0 +1,173 @@
+package mqProducer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseCompressionCodec(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected sarama.CompressionCodec
+		wantErr  bool
+	}{
+		{"", sarama.CompressionNone, false},
+		{"none", sarama.CompressionNone, false},
+		{"gzip", sarama.CompressionGZIP, false},
+		{"snappy", sarama.CompressionSnappy, false},
+		{"lz4", sarama.CompressionLZ4, false},
+		{"zstd", sarama.CompressionZSTD, false},
+		{"bogus", sarama.CompressionNone, true},
+	}
+
+	for _, c := range cases {
+		codec, err := parseCompressionCodec(c.name)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseCompressionCodec(%q): expected an error, got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCompressionCodec(%q): unexpected error: %v", c.name, err)
+		}
+		if codec != c.expected {
+			t.Errorf("parseCompressionCodec(%q) = %v, want %v", c.name, codec, c.expected)
+		}
+	}
+}
+
+func newTestAsyncProducer(maxInflight int) *kafkaSaramaProducer {
+	k := &kafkaSaramaProducer{
+		asyncClient: struct{ sarama.AsyncProducer }{}, // non-nil marker, never called by these tests
+		maxInflight: maxInflight,
+		inflightSem: make(chan struct{}, maxInflight),
+	}
+	k.seqCond = sync.NewCond(&k.seqMu)
+	return k
+}
+
+func TestReserveInflightSlotBlocksUntilCtxDone(t *testing.T) {
+	k := newTestAsyncProducer(1)
+	if err := k.reserveInflightSlot(context.Background()); err != nil {
+		t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reserveErr := make(chan error, 1)
+	go func() { reserveErr <- k.reserveInflightSlot(ctx) }()
+
+	select {
+	case err := <-reserveErr:
+		t.Fatalf("reserveInflightSlot returned %v before the slot was freed or ctx cancelled", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-reserveErr:
+		if err == nil {
+			t.Fatal("reserveInflightSlot: expected an error after ctx cancellation, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reserveInflightSlot did not return after ctx cancellation")
+	}
+}
+
+func TestReserveInflightSlotUnblocksOnAckOne(t *testing.T) {
+	k := newTestAsyncProducer(1)
+	if err := k.reserveInflightSlot(context.Background()); err != nil {
+		t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+	}
+
+	reserveErr := make(chan error, 1)
+	go func() { reserveErr <- k.reserveInflightSlot(context.Background()) }()
+
+	select {
+	case err := <-reserveErr:
+		t.Fatalf("reserveInflightSlot returned %v before the slot was freed", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	k.ackOne(nil)
+	select {
+	case err := <-reserveErr:
+		if err != nil {
+			t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reserveInflightSlot did not return after its slot was freed")
+	}
+}
+
+func TestFlushWaitsForOutstandingAcks(t *testing.T) {
+	k := newTestAsyncProducer(2)
+	for i := 0; i < 2; i++ {
+		if err := k.reserveInflightSlot(context.Background()); err != nil {
+			t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+		}
+	}
+
+	flushErr := make(chan error, 1)
+	go func() { flushErr <- k.Flush(context.Background()) }()
+
+	select {
+	case err := <-flushErr:
+		t.Fatalf("Flush returned %v before all in-flight messages were acked", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	k.ackOne(nil)
+	k.ackOne(errors.New("broker rejected message"))
+
+	select {
+	case err := <-flushErr:
+		if err == nil || err.Error() != "broker rejected message" {
+			t.Fatalf("Flush: expected the pending async error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush did not return after every in-flight message was acked")
+	}
+}
+
+// TestFlushIgnoresMessagesSentAfterItStarted verifies that Flush only waits
+// for its own snapshot of reservedSeq: a message sent by another goroutine
+// after Flush begins must not extend how long that Flush call blocks, or a
+// running changefeed under sustained load could stall resolvedTs forever.
+func TestFlushIgnoresMessagesSentAfterItStarted(t *testing.T) {
+	k := newTestAsyncProducer(2)
+	if err := k.reserveInflightSlot(context.Background()); err != nil {
+		t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+	}
+
+	flushErr := make(chan error, 1)
+	go func() { flushErr <- k.Flush(context.Background()) }()
+
+	select {
+	case err := <-flushErr:
+		t.Fatalf("Flush returned %v before the pending message was acked", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A concurrent send races with Flush and is never acked; it must not be
+	// able to block Flush, which only covers what was reserved before it
+	// started.
+	if err := k.reserveInflightSlot(context.Background()); err != nil {
+		t.Fatalf("reserveInflightSlot: unexpected error: %v", err)
+	}
+
+	k.ackOne(nil)
+	select {
+	case err := <-flushErr:
+		if err != nil {
+			t.Fatalf("Flush: unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush did not return once the message reserved before it started was acked")
+	}
+}
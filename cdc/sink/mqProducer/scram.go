@@ -0,0 +1,49 @@
+package mqProducer
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg/scram"
+)
+
+var sha256HashGenerator scram.HashGeneratorFcn = sha256.New
+var sha512HashGenerator scram.HashGeneratorFcn = sha512.New
+
+// xdgSCRAMClient adapts github.com/xdg/scram to sarama.SCRAMClient so the
+// Sarama config can drive a SCRAM-SHA-256/512 handshake.
+type xdgSCRAMClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *xdgSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	c.Client, err = c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = c.Client.NewConversation()
+	return nil
+}
+
+func (c *xdgSCRAMClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *xdgSCRAMClient) Done() bool {
+	return c.ClientConversation.Done()
+}
+
+// scramClientGeneratorFunc returns the sarama.SCRAMClientGeneratorFunc for
+// the given SCRAM mechanism.
+func scramClientGeneratorFunc(mechanism sarama.SASLMechanism) func() sarama.SCRAMClient {
+	generator := sha256HashGenerator
+	if mechanism == sarama.SASLTypeSCRAMSHA512 {
+		generator = sha512HashGenerator
+	}
+	return func() sarama.SCRAMClient {
+		return &xdgSCRAMClient{HashGeneratorFcn: generator}
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +15,8 @@ import (
 	pd "github.com/pingcap/pd/client"
 	"github.com/pingcap/ticdc/cdc/kv"
 	"github.com/pingcap/ticdc/cdc/model"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/pingcap/ticdc/cdc/util"
 	"github.com/pingcap/tidb/store/tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/spf13/cobra"
@@ -31,15 +34,27 @@ func init() {
 	cliCmd.Flags().StringVar(&sinkURI, "sink-uri", "root@tcp(127.0.0.1:3306)/", "sink uri")
 	cliCmd.Flags().StringVar(&configFile, "config", "", "path of the configuration file")
 	cliCmd.Flags().StringSliceVar(&opts, "opts", nil, "in key=value format")
+	cliCmd.Flags().StringVar(&probeGroup, "probe-group", "", "consumer group to verify readiness for once the changefeed has produced data; see --probe-before-create")
+	cliCmd.Flags().BoolVar(&allowEmptyGroup, "allow-empty-group", false, "allow --probe-group to have no committed offsets yet")
+	cliCmd.Flags().BoolVar(&probeBeforeCreate, "probe-before-create", false, "with --probe-group, verify the consumer group's offsets before creating the changefeed; only meaningful if the group already consumes the topic for another reason, since a brand new changefeed has not produced anything yet")
+	cliCmd.Flags().StringVar(&pdCAPath, "pd-ca", "", "CA certificate path for PD/etcd, used to dial --pd-addr; unrelated to the Kafka sink's own ca=/cert=/key=")
+	cliCmd.Flags().StringVar(&pdCertPath, "pd-cert", "", "certificate path for PD/etcd")
+	cliCmd.Flags().StringVar(&pdKeyPath, "pd-key", "", "private key path for PD/etcd")
 }
 
 var (
-	opts       []string
-	pdAddress  string
-	startTs    uint64
-	targetTs   uint64
-	sinkURI    string
-	configFile string
+	opts              []string
+	pdAddress         string
+	startTs           uint64
+	targetTs          uint64
+	sinkURI           string
+	configFile        string
+	probeGroup        string
+	allowEmptyGroup   bool
+	probeBeforeCreate bool
+	pdCAPath          string
+	pdCertPath        string
+	pdKeyPath         string
 )
 
 var cliCmd = &cobra.Command{
@@ -48,9 +63,22 @@ var cliCmd = &cobra.Command{
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
+
+		sinkCredential, err := securityOptionFromSinkURI(sinkURI)
+		if err != nil {
+			return err
+		}
+
+		pdCredential := util.SecurityOption{CAPath: pdCAPath, CertPath: pdCertPath, KeyPath: pdKeyPath}
+		pdTLSCfg, err := pdCredential.ToTLSConfig()
+		if err != nil {
+			return err
+		}
+
 		etcdCli, err := clientv3.New(clientv3.Config{
 			Endpoints:   []string{pdAddress},
 			DialTimeout: 5 * time.Second,
+			TLS:         pdTLSCfg,
 			DialOptions: []grpc.DialOption{
 				grpc.WithConnectParams(grpc.ConnectParams{
 					Backoff: backoff.Config{
@@ -67,7 +95,11 @@ var cliCmd = &cobra.Command{
 			return err
 		}
 		cli := kv.NewCDCEtcdClient(etcdCli)
-		pdCli, err := pd.NewClient([]string{pdAddress}, pd.SecurityOption{})
+		pdCli, err := pd.NewClient([]string{pdAddress}, pd.SecurityOption{
+			CAPath:   pdCredential.CAPath,
+			CertPath: pdCredential.CertPath,
+			KeyPath:  pdCredential.KeyPath,
+		})
 		if err != nil {
 			return err
 		}
@@ -84,12 +116,14 @@ var cliCmd = &cobra.Command{
 			return err
 		}
 
-		cfg := new(model.ReplicaConfig)
+		fileCfg := new(replicaConfigWithSecurity)
 		if len(configFile) > 0 {
-			if err := strictDecodeFile(configFile, "cdc", cfg); err != nil {
+			if err := strictDecodeFile(configFile, "cdc", fileCfg); err != nil {
 				return err
 			}
+			sinkCredential = mergeSecurityOption(sinkCredential, fileCfg.SinkSecurity.toSecurityOption())
 		}
+		cfg := &fileCfg.ReplicaConfig
 
 		detail := &model.ChangeFeedInfo{
 			SinkURI:    sinkURI,
@@ -116,6 +150,16 @@ var cliCmd = &cobra.Command{
 			detail.Opts[key] = value
 		}
 
+		if err := validateSinkURI(sinkURI, detail.Opts); err != nil {
+			return err
+		}
+
+		if probeBeforeCreate {
+			if err := probeKafkaSinkReadiness(ctx, sinkURI, sinkCredential); err != nil {
+				return err
+			}
+		}
+
 		d, err := detail.Marshal()
 		if err != nil {
 			return err
@@ -143,6 +187,150 @@ func verifyStartTs(ctx context.Context, startTs uint64, cli kv.CDCEtcdClient) er
 	return nil
 }
 
+// securityOptionFromSinkURI extracts TLS, SASL, and Kerberos settings for
+// the Kafka sink from the sink URI's query parameters (ca=, cert=, key=,
+// sasl-user=, sasl-mechanism=, kerberos-service-name=, kerberos-keytab=,
+// kerberos-realm=, kerberos-username=, kerberos-password=,
+// kerberos-config-path=, ...). This SecurityOption only ever reaches the
+// Sarama producer; PD/etcd are a separate server with their own CA and are
+// configured independently via --pd-ca/--pd-cert/--pd-key.
+func securityOptionFromSinkURI(uri string) (util.SecurityOption, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return util.SecurityOption{}, errors.Trace(err)
+	}
+	q := parsed.Query()
+	return util.SecurityOption{
+		CAPath:              q.Get("ca"),
+		CertPath:            q.Get("cert"),
+		KeyPath:             q.Get("key"),
+		SASLUser:            q.Get("sasl-user"),
+		SASLPassword:        q.Get("sasl-password"),
+		SASLMechanism:       q.Get("sasl-mechanism"),
+		KerberosServiceName: q.Get("kerberos-service-name"),
+		KerberosRealm:       q.Get("kerberos-realm"),
+		KerberosUsername:    q.Get("kerberos-username"),
+		KerberosPassword:    q.Get("kerberos-password"),
+		KerberosKeytabPath:  q.Get("kerberos-keytab"),
+		KerberosConfigPath:  q.Get("kerberos-config-path"),
+	}, nil
+}
+
+// replicaConfigWithSecurity decodes the same TOML config file as
+// model.ReplicaConfig, plus an additional [sink-security] table carrying
+// the same TLS/SASL/Kerberos settings accepted as sink-URI query
+// parameters, so operators can configure them once instead of repeating
+// them on every sink URI. ReplicaConfig is embedded rather than extended
+// directly since it is declared outside this package.
+type replicaConfigWithSecurity struct {
+	model.ReplicaConfig
+	SinkSecurity securityTOMLConfig `toml:"sink-security"`
+}
+
+// securityTOMLConfig mirrors util.SecurityOption for TOML decoding.
+type securityTOMLConfig struct {
+	CAPath              string `toml:"ca"`
+	CertPath            string `toml:"cert"`
+	KeyPath             string `toml:"key"`
+	SASLUser            string `toml:"sasl-user"`
+	SASLPassword        string `toml:"sasl-password"`
+	SASLMechanism       string `toml:"sasl-mechanism"`
+	KerberosServiceName string `toml:"kerberos-service-name"`
+	KerberosRealm       string `toml:"kerberos-realm"`
+	KerberosUsername    string `toml:"kerberos-username"`
+	KerberosPassword    string `toml:"kerberos-password"`
+	KerberosKeytabPath  string `toml:"kerberos-keytab"`
+	KerberosConfigPath  string `toml:"kerberos-config-path"`
+}
+
+func (s securityTOMLConfig) toSecurityOption() util.SecurityOption {
+	return util.SecurityOption{
+		CAPath:              s.CAPath,
+		CertPath:            s.CertPath,
+		KeyPath:             s.KeyPath,
+		SASLUser:            s.SASLUser,
+		SASLPassword:        s.SASLPassword,
+		SASLMechanism:       s.SASLMechanism,
+		KerberosServiceName: s.KerberosServiceName,
+		KerberosRealm:       s.KerberosRealm,
+		KerberosUsername:    s.KerberosUsername,
+		KerberosPassword:    s.KerberosPassword,
+		KerberosKeytabPath:  s.KerberosKeytabPath,
+		KerberosConfigPath:  s.KerberosConfigPath,
+	}
+}
+
+// mergeSecurityOption fills any field left empty in uriOption with the
+// corresponding field from fileOption, so the sink URI's query parameters
+// take precedence over the TOML config file's [sink-security] table.
+func mergeSecurityOption(uriOption, fileOption util.SecurityOption) util.SecurityOption {
+	merged := uriOption
+	if merged.CAPath == "" {
+		merged.CAPath = fileOption.CAPath
+	}
+	if merged.CertPath == "" {
+		merged.CertPath = fileOption.CertPath
+	}
+	if merged.KeyPath == "" {
+		merged.KeyPath = fileOption.KeyPath
+	}
+	if merged.SASLMechanism == "" {
+		merged.SASLMechanism = fileOption.SASLMechanism
+	}
+	if merged.SASLUser == "" {
+		merged.SASLUser = fileOption.SASLUser
+	}
+	if merged.SASLPassword == "" {
+		merged.SASLPassword = fileOption.SASLPassword
+	}
+	if merged.KerberosServiceName == "" {
+		merged.KerberosServiceName = fileOption.KerberosServiceName
+	}
+	if merged.KerberosRealm == "" {
+		merged.KerberosRealm = fileOption.KerberosRealm
+	}
+	if merged.KerberosUsername == "" {
+		merged.KerberosUsername = fileOption.KerberosUsername
+	}
+	if merged.KerberosPassword == "" {
+		merged.KerberosPassword = fileOption.KerberosPassword
+	}
+	if merged.KerberosKeytabPath == "" {
+		merged.KerberosKeytabPath = fileOption.KerberosKeytabPath
+	}
+	if merged.KerberosConfigPath == "" {
+		merged.KerberosConfigPath = fileOption.KerberosConfigPath
+	}
+	return merged
+}
+
+// validateSinkURI checks that a Kafka sink URI names a topic and that the
+// requested encoding protocol, whether given as the `protocol=` sink-uri
+// query parameter or via `opts protocol=...`, is one this version of TiCDC
+// understands.
+func validateSinkURI(uri string, opts map[string]string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	protocolName := opts["protocol"]
+	if p := parsed.Query().Get("protocol"); p != "" {
+		protocolName = p
+	}
+	if _, err := codec.ParseProtocol(protocolName); err != nil {
+		return errors.Trace(err)
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "kafka", "kafka+ssl":
+		if strings.TrimPrefix(parsed.Path, "/") == "" {
+			return errors.Errorf("the topic name must not be empty in sink uri: %s", uri)
+		}
+	}
+	return nil
+}
+
 // strictDecodeFile decodes the toml file strictly. If any item in confFile file is not mapped
 // into the Config struct, issue an error and stop the server from starting.
 func strictDecodeFile(path, component string, cfg interface{}) error {
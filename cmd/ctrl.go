@@ -57,6 +57,8 @@ func init() {
 	ctrlCmd.Flags().StringVar(&ctrlCfID, "changefeed-id", "", "changefeed ID")
 	ctrlCmd.Flags().StringVar(&ctrlCaptureID, "capture-id", "", "capture ID")
 	ctrlCmd.Flags().StringVar(&ctrlCommand, "cmd", CtrlQueryCaptures, "controller command type")
+	ctrlCmd.Flags().StringVar(&probeGroup, "probe-group", "", "for CtrlQueryCfStatus on a Kafka sink, the consumer group to check offset readiness for")
+	ctrlCmd.Flags().BoolVar(&allowEmptyGroup, "allow-empty-group", false, "allow --probe-group to have no committed offsets yet")
 }
 
 var (
@@ -118,11 +120,24 @@ var ctrlCmd = &cobra.Command{
 			}
 			return jsonPrint(info)
 		case CtrlQueryCfStatus:
-			info, err := cli.GetChangeFeedStatus(context.Background(), ctrlCfID)
+			status, err := cli.GetChangeFeedStatus(context.Background(), ctrlCfID)
 			if err != nil {
 				return err
 			}
-			return jsonPrint(info)
+			if probeGroup != "" {
+				cfInfo, err := cli.GetChangeFeedInfo(context.Background(), ctrlCfID)
+				if err != nil {
+					return err
+				}
+				sinkCredential, err := securityOptionFromSinkURI(cfInfo.SinkURI)
+				if err != nil {
+					return err
+				}
+				if err := probeKafkaSinkReadiness(context.Background(), cfInfo.SinkURI, sinkCredential); err != nil {
+					return err
+				}
+			}
+			return jsonPrint(status)
 		case CtrlQueryCfs:
 			_, raw, err := cli.GetChangeFeeds(context.Background())
 			if err != nil {
@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	_ "github.com/go-sql-driver/mysql" // mysql driver
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/sink/codec"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func init() {
+	rootCmd.AddCommand(kafkaConsumerCmd)
+
+	kafkaConsumerCmd.Flags().StringVar(&kafkaUpstreamURI, "upstream-uri", "", "upstream sink uri of the changefeed being verified, e.g. kafka://127.0.0.1:9092/topic")
+	kafkaConsumerCmd.Flags().StringVar(&kafkaDownstreamURI, "downstream-uri", "", "downstream uri to replay row changes into, e.g. mysql://root@tcp(127.0.0.1:3306)/; leave empty to print JSON to stdout")
+	kafkaConsumerCmd.Flags().StringVar(&kafkaConsumerConfig, "config", "", "path of the configuration file")
+	kafkaConsumerCmd.Flags().StringVar(&kafkaConsumerProtocol, "protocol", "default", "the protocol used to encode messages on the sink topic; only \"default\" is currently supported for decoding")
+	kafkaConsumerCmd.Flags().StringVar(&kafkaConsumerGroup, "consumer-group", "ticdc-kafka-consumer-verify", "consumer group used to commit offsets, so a restart resumes after the last applied row instead of reprocessing the whole topic")
+}
+
+var (
+	kafkaUpstreamURI      string
+	kafkaDownstreamURI    string
+	kafkaConsumerConfig   string
+	kafkaConsumerProtocol string
+	kafkaConsumerGroup    string
+)
+
+// kafkaConsumerCmd consumes from a changefeed's sink topic and either
+// replays the decoded row changes into a downstream MySQL instance or
+// prints them as JSON, giving operators a first-class way to check that a
+// changefeed produced correct output without writing a bespoke consumer.
+var kafkaConsumerCmd = &cobra.Command{
+	Hidden: true,
+	Use:    "kafka-consumer",
+	Short:  "consume from a changefeed's Kafka sink topic for end-to-end verification",
+	Long:   ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		protocol, err := codec.ParseProtocol(kafkaConsumerProtocol)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if protocol != codec.ProtocolDefault {
+			// decodeMessage only knows how to parse the default envelope;
+			// fail fast instead of silently dropping every record in
+			// consumePartition when another protocol is requested.
+			return errors.Errorf("kafka-consumer does not yet support decoding protocol %q, only %q is supported", protocol, codec.ProtocolDefault)
+		}
+
+		addrs, topic, err := parseKafkaUpstreamURI(kafkaUpstreamURI)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		var db *sql.DB
+		if kafkaDownstreamURI != "" {
+			dsn := strings.TrimPrefix(kafkaDownstreamURI, "mysql://")
+			db, err = sql.Open("mysql", dsn)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			defer db.Close()
+		}
+
+		consumer, err := newKafkaConsumer(addrs, topic, kafkaConsumerGroup, protocol, db)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer consumer.Close()
+		return consumer.run(context.Background())
+	},
+}
+
+// parseKafkaUpstreamURI splits a `kafka://host:port,host:port/topic` uri
+// into broker addresses and a topic name.
+func parseKafkaUpstreamURI(uri string) ([]string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	if parsed.Scheme != "kafka" {
+		return nil, "", errors.Errorf("unsupported upstream scheme: %s", parsed.Scheme)
+	}
+	topic := strings.TrimPrefix(parsed.Path, "/")
+	if topic == "" {
+		return nil, "", errors.Errorf("the topic name must not be empty in upstream uri: %s", uri)
+	}
+	return strings.Split(parsed.Host, ","), topic, nil
+}
+
+// kafkaMessage is a single decoded message read off a partition, tagged
+// with enough information to order it against messages from other
+// partitions and to commit its offset once applied downstream.
+type kafkaMessage struct {
+	CommitTs  uint64
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	// IsResolved marks a resolved-ts watermark message rather than a row
+	// change; it carries no row data, only CommitTs.
+	IsResolved bool
+}
+
+// messageHeap orders kafkaMessages by (CommitTs, Partition) so that rows
+// with the same commitTs come out in a deterministic, partition-stable
+// order.
+type messageHeap []*kafkaMessage
+
+func (h messageHeap) Len() int { return len(h) }
+func (h messageHeap) Less(i, j int) bool {
+	if h[i].CommitTs != h[j].CommitTs {
+		return h[i].CommitTs < h[j].CommitTs
+	}
+	return h[i].Partition < h[j].Partition
+}
+func (h messageHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *messageHeap) Push(x interface{}) { *h = append(*h, x.(*kafkaMessage)) }
+func (h *messageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// kafkaConsumer consumes every partition of a sink topic, merges the
+// per-partition streams in commitTs order using a min-heap, and applies
+// each row downstream (or prints it) before committing its offset to the
+// consumer group so a restart resumes after the last applied row.
+type kafkaConsumer struct {
+	client        sarama.Client
+	consumer      sarama.Consumer
+	offsetManager sarama.OffsetManager
+	topic         string
+	protocol      codec.Protocol
+	db            *sql.DB
+
+	partitionNum int32
+
+	mu                  sync.Mutex
+	heap                messageHeap
+	resolvedTs          map[int32]uint64
+	partitionOffsetMgrs map[int32]sarama.PartitionOffsetManager
+	partitionMsg        chan *kafkaMessage
+}
+
+// newKafkaConsumer creates a kafkaConsumer that will read every partition
+// of topic from the given brokers, committing its progress under group.
+func newKafkaConsumer(addrs []string, topic, group string, protocol codec.Protocol, db *sql.DB) (*kafkaConsumer, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	client, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	offsetManager, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	partitions, err := consumer.Partitions(topic)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &kafkaConsumer{
+		client:              client,
+		consumer:            consumer,
+		offsetManager:       offsetManager,
+		topic:               topic,
+		protocol:            protocol,
+		db:                  db,
+		partitionNum:        int32(len(partitions)),
+		resolvedTs:          make(map[int32]uint64, len(partitions)),
+		partitionOffsetMgrs: make(map[int32]sarama.PartitionOffsetManager, len(partitions)),
+		partitionMsg:        make(chan *kafkaMessage, 256),
+	}, nil
+}
+
+// Close releases the consumer's Kafka connections, flushing any
+// outstanding offset commits first.
+func (c *kafkaConsumer) Close() error {
+	for _, pom := range c.partitionOffsetMgrs {
+		pom.Close()
+	}
+	if err := c.offsetManager.Close(); err != nil {
+		log.Warn("failed to close kafka offset manager", zap.Error(err))
+	}
+	if err := c.consumer.Close(); err != nil {
+		log.Warn("failed to close kafka consumer", zap.Error(err))
+	}
+	return errors.Trace(c.client.Close())
+}
+
+// run consumes every partition concurrently and merges the results in
+// commitTs order, applying each row downstream and committing its offset
+// to the consumer group once applied.
+func (c *kafkaConsumer) run(ctx context.Context) error {
+	for i := int32(0); i < c.partitionNum; i++ {
+		pom, err := c.offsetManager.ManagePartition(c.topic, i)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.partitionOffsetMgrs[i] = pom
+
+		startOffset, _ := pom.NextOffset()
+		pc, err := c.consumer.ConsumePartition(c.topic, i, startOffset)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		go c.consumePartition(ctx, i, pc)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case msg := <-c.partitionMsg:
+			if err := c.handleMessage(msg); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+}
+
+func (c *kafkaConsumer) consumePartition(ctx context.Context, partition int32, pc sarama.PartitionConsumer) {
+	defer pc.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			msg, err := c.decodeMessage(partition, m)
+			if err != nil {
+				log.Warn("failed to decode kafka message, skipping", zap.Int32("partition", partition), zap.Error(err))
+				continue
+			}
+			select {
+			case c.partitionMsg <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// decodeMessage parses a raw Kafka record into a kafkaMessage according to
+// the configured protocol.
+func (c *kafkaConsumer) decodeMessage(partition int32, m *sarama.ConsumerMessage) (*kafkaMessage, error) {
+	switch c.protocol {
+	case codec.ProtocolDefault:
+		return c.decodeDefaultMessage(partition, m)
+	default:
+		// The canal, canal-json, avro, and maxwell encoders have their own
+		// wire formats that this consumer does not yet know how to parse;
+		// fail loudly rather than mis-decode them as the default envelope.
+		return nil, errors.Errorf("kafka-consumer does not yet support decoding protocol %q", c.protocol)
+	}
+}
+
+// decodeDefaultMessage parses the default protocol's envelope, which
+// carries the row's commitTs either in the key or as a resolved-ts
+// watermark.
+func (c *kafkaConsumer) decodeDefaultMessage(partition int32, m *sarama.ConsumerMessage) (*kafkaMessage, error) {
+	var envelope struct {
+		CommitTs   uint64 `json:"commitTs"`
+		IsResolved bool   `json:"resolved"`
+	}
+	if err := json.Unmarshal(m.Key, &envelope); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &kafkaMessage{
+		CommitTs:   envelope.CommitTs,
+		Partition:  partition,
+		Offset:     m.Offset,
+		Key:        m.Key,
+		Value:      m.Value,
+		IsResolved: envelope.IsResolved,
+	}, nil
+}
+
+// handleMessage pushes a message onto the merge heap and, once every
+// partition has reported a watermark at or past the heap's minimum commitTs,
+// pops and applies messages in order.
+func (c *kafkaConsumer) handleMessage(msg *kafkaMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if msg.IsResolved {
+		c.resolvedTs[msg.Partition] = msg.CommitTs
+	} else {
+		heap.Push(&c.heap, msg)
+	}
+
+	for c.heap.Len() > 0 && c.readyToEmitLocked(c.heap[0].CommitTs) {
+		next := heap.Pop(&c.heap).(*kafkaMessage)
+		if err := c.apply(next); err != nil {
+			return errors.Trace(err)
+		}
+		if pom, ok := c.partitionOffsetMgrs[next.Partition]; ok {
+			pom.MarkOffset(next.Offset+1, "")
+		}
+	}
+	return nil
+}
+
+// readyToEmitLocked reports whether every partition's resolved-ts watermark
+// has reached commitTs, meaning no earlier row can still arrive.
+func (c *kafkaConsumer) readyToEmitLocked(commitTs uint64) bool {
+	if int32(len(c.resolvedTs)) < c.partitionNum {
+		return false
+	}
+	for _, ts := range c.resolvedTs {
+		if ts < commitTs {
+			return false
+		}
+	}
+	return true
+}
+
+// apply replays a row change into the downstream MySQL instance, or prints
+// it as JSON when no downstream DSN was given.
+func (c *kafkaConsumer) apply(msg *kafkaMessage) error {
+	if c.db == nil {
+		fmt.Printf("%s\n", msg.Value)
+		return nil
+	}
+
+	var row struct {
+		Table string        `json:"table"`
+		Query string        `json:"query"`
+		Args  []interface{} `json:"args"`
+	}
+	if err := json.Unmarshal(msg.Value, &row); err != nil {
+		return errors.Trace(err)
+	}
+	if row.Query == "" {
+		return nil
+	}
+	// Args is a positional list, in the same order as row.Query's
+	// placeholders; the producer side must encode it that way rather than
+	// as a map, whose key order is not preserved across JSON round-trips.
+	_, err := c.db.Exec(row.Query, row.Args...)
+	return errors.Trace(err)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"container/heap"
+	"testing"
+)
+
+func TestMessageHeapOrdering(t *testing.T) {
+	h := &messageHeap{}
+	heap.Init(h)
+	heap.Push(h, &kafkaMessage{CommitTs: 5, Partition: 2})
+	heap.Push(h, &kafkaMessage{CommitTs: 3, Partition: 1})
+	heap.Push(h, &kafkaMessage{CommitTs: 3, Partition: 0})
+	heap.Push(h, &kafkaMessage{CommitTs: 5, Partition: 1})
+
+	want := []struct {
+		commitTs  uint64
+		partition int32
+	}{
+		{3, 0},
+		{3, 1},
+		{5, 1},
+		{5, 2},
+	}
+	for i, w := range want {
+		got := heap.Pop(h).(*kafkaMessage)
+		if got.CommitTs != w.commitTs || got.Partition != w.partition {
+			t.Errorf("pop %d: got (CommitTs=%d, Partition=%d), want (CommitTs=%d, Partition=%d)",
+				i, got.CommitTs, got.Partition, w.commitTs, w.partition)
+		}
+	}
+}
+
+func TestReadyToEmitLocked(t *testing.T) {
+	c := &kafkaConsumer{
+		partitionNum: 2,
+		resolvedTs:   make(map[int32]uint64),
+	}
+
+	if c.readyToEmitLocked(10) {
+		t.Errorf("readyToEmitLocked(10) = true before any partition reported a watermark, want false")
+	}
+
+	c.resolvedTs[0] = 10
+	if c.readyToEmitLocked(10) {
+		t.Errorf("readyToEmitLocked(10) = true with only 1/2 partitions reporting, want false")
+	}
+
+	c.resolvedTs[1] = 5
+	if c.readyToEmitLocked(10) {
+		t.Errorf("readyToEmitLocked(10) = true when partition 1's watermark (5) hasn't reached commitTs, want false")
+	}
+
+	c.resolvedTs[1] = 10
+	if !c.readyToEmitLocked(10) {
+		t.Errorf("readyToEmitLocked(10) = false once every partition's watermark has reached commitTs, want true")
+	}
+}
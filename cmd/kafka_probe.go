@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/ticdc/cdc/sink/mqProducer"
+	"github.com/pingcap/ticdc/cdc/util"
+	"go.uber.org/zap"
+)
+
+// probeKafkaSinkReadiness checks, for a Kafka sink uri, that --probe-group
+// has committed offsets at or before the topic's current high-water marks
+// on every partition before a changefeed is allowed to be marked ready.
+// Non-Kafka sinks and sinks without --probe-group set are left unchecked.
+func probeKafkaSinkReadiness(ctx context.Context, sinkURI string, credential util.SecurityOption) error {
+	parsed, err := url.Parse(sinkURI)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if strings.ToLower(parsed.Scheme) != "kafka" && strings.ToLower(parsed.Scheme) != "kafka+ssl" {
+		return nil
+	}
+	if probeGroup == "" {
+		return nil
+	}
+
+	topic := strings.TrimPrefix(parsed.Path, "/")
+	addrs := strings.Split(parsed.Host, ",")
+
+	cfg := sarama.NewConfig()
+	if err := mqProducer.ConfigureSecurity(cfg, credential); err != nil {
+		return errors.Trace(err)
+	}
+
+	return waitConsumerGroupReady(ctx, addrs, cfg, topic, probeGroup, allowEmptyGroup)
+}
+
+// probeBackoff is the exponential backoff schedule used while waiting for a
+// consumer group to report offsets for a newly created changefeed's topic.
+var probeBackoff = []time.Duration{
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	4 * time.Second,
+	8 * time.Second,
+	16 * time.Second,
+	30 * time.Second,
+}
+
+// waitConsumerGroupReady polls the broker, waiting out each probeBackoff
+// step in turn, until every partition of topic has a committed offset at or
+// before its current high-water mark for the given consumer group, or no
+// partition has a committed offset for the group and the caller explicitly
+// allowed that with allowEmptyGroup. Once the schedule is exhausted it
+// returns the last check's error. It guards against a
+// changefeed being marked "running" while a downstream consumer hasn't
+// subscribed yet, which would silently drop events produced before the
+// subscription caught up.
+func waitConsumerGroupReady(ctx context.Context, addrs []string, cfg *sarama.Config, topic, group string, allowEmptyGroup bool) error {
+	admin, err := sarama.NewClusterAdmin(addrs, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer admin.Close()
+
+	client, err := sarama.NewClient(addrs, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer client.Close()
+
+	topics, err := admin.ListTopics()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, ok := topics[topic]; !ok {
+		return errors.Errorf("topic %s does not exist", topic)
+	}
+
+	var lastErr error
+	for _, backoff := range append(probeBackoff, 0) {
+		lastErr = checkConsumerGroupOffsets(admin, client, topic, group, allowEmptyGroup)
+		if lastErr == nil {
+			return nil
+		}
+		if backoff == 0 {
+			break
+		}
+		log.Info("consumer group not yet ready, retrying", zap.String("group", group), zap.Error(lastErr), zap.Duration("backoff", backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+	return errors.Annotatef(lastErr, "consumer group %s never became ready for topic %s", group, topic)
+}
+
+// checkConsumerGroupOffsets reports an error unless every partition of
+// topic has a committed offset for group that is not ahead of the
+// partition's current high-water mark. When no partition has a committed
+// offset, it returns nil only if allowEmptyGroup is set.
+func checkConsumerGroupOffsets(admin sarama.ClusterAdmin, client sarama.Client, topic, group string, allowEmptyGroup bool) error {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	blocks, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ready := 0
+	for _, partition := range partitions {
+		block := blocks.GetBlock(topic, partition)
+		if block == nil || block.Offset < 0 {
+			continue
+		}
+
+		highWaterMark, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if block.Offset > highWaterMark {
+			return errors.Errorf("partition %d: committed offset %d is ahead of high-water mark %d", partition, block.Offset, highWaterMark)
+		}
+		ready++
+	}
+
+	if ready == 0 {
+		if allowEmptyGroup {
+			return nil
+		}
+		return errors.Errorf("consumer group %s has no committed offsets yet; pass --allow-empty-group to skip this check", group)
+	}
+	if ready < len(partitions) {
+		return errors.Errorf("consumer group %s has only committed offsets for %d/%d partitions", group, ready, len(partitions))
+	}
+	return nil
+}